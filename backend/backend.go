@@ -6,6 +6,8 @@ package backend
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform/config/module"
 	"github.com/hashicorp/terraform/state"
@@ -20,17 +22,54 @@ type Backend interface {
 	Validate(*terraform.ResourceConfig) ([]string, []error)
 	Configure(*terraform.ResourceConfig) error
 
-	// State returns the current state for this environment. This state may
-	// not be loaded locally: the proper APIs should be called on state.State
-	// to load the state.
+	// State returns the state for the currently selected workspace. This
+	// state may not be loaded locally: the proper APIs should be called
+	// on state.State to load the state. For backends implementing
+	// MultiState, this is a convenience equivalent to calling StateMgr
+	// with the currently selected workspace name.
 	State() (state.State, error)
 }
 
+// DefaultStateName is the name of the default, initial workspace that every
+// backend must support, even if it never exposes any other workspace.
+const DefaultStateName = "default"
+
+// MultiState is implemented by backends that support multiple named
+// workspaces (for example dev/stage/prod) under a single backend
+// configuration, so that a team can switch between environments without
+// re-initializing the backend.
+type MultiState interface {
+	// States returns the names of all the workspaces this backend knows
+	// about.
+	States() ([]string, error)
+
+	// DeleteState removes the named workspace and its state. It is an
+	// error to delete the currently selected workspace.
+	DeleteState(name string) error
+
+	// StateMgr returns the state.State for the named workspace, creating
+	// the workspace if it doesn't already exist.
+	StateMgr(name string) (state.State, error)
+}
+
 // Enhanced implements additional behavior on top of a normal backend.
 //
 // Enhanced backends allow customizing the behavior of Terraform operations.
 // This allows Terraform to potentially run operations remotely, load
 // configurations from external sources, etc.
+//
+// If the Operation has any PolicyCheckers set, Enhanced backends must run
+// them after a plan is produced but before an apply is allowed to proceed,
+// surface any violations through the Operation's UIOut, and abort the apply
+// if a checker reports a hard failure.
+//
+// Enhanced backends that also implement MultiState must honor the
+// Operation's Workspace field, running against that workspace's state
+// instead of whatever workspace is currently selected.
+//
+// Enhanced backends must also implement the cancelation state machine
+// documented on RunningOperation, reacting to both the parent context
+// being canceled and to RunningOperation.Stop/Cancel being called.
 type Enhanced interface {
 	Backend
 
@@ -41,6 +80,92 @@ type Enhanced interface {
 	Operation(context.Context, *Operation) (*RunningOperation, error)
 }
 
+// PolicyChecker is implemented by policy-evaluation engines (such as
+// Sentinel or OPA) that can be layered on top of any Enhanced backend.
+// Enhanced backends run each configured PolicyChecker against the plan
+// after it is produced but before apply proceeds.
+type PolicyChecker interface {
+	// Check evaluates the given plan and state, returning whether the
+	// policy passed and any violations that were found.
+	Check(context.Context, *terraform.Plan, *terraform.State) (PolicyResult, error)
+}
+
+// PolicyResult is used in two related but distinct ways: as the direct
+// return value of a single PolicyChecker.Check, and as the aggregate of
+// every configured PolicyChecker's results on RunningOperation.PolicyResult.
+//
+// Check has no access to the Operation and so cannot see PolicyOverride;
+// the Passed it returns therefore reflects only its own SoftFailures and
+// HardFailures, ignoring override. Enhanced backends must not surface a
+// checker's own Passed as the operation's outcome. Instead, after running
+// every PolicyChecker, the backend builds the aggregate PolicyResult
+// itself: HardFailures and SoftFailures are the union across all
+// checkers, and Passed is true only if HardFailures is empty and either
+// SoftFailures is also empty or Operation.PolicyOverride is set.
+type PolicyResult struct {
+	// Passed reports whether this result, taken on its own, should allow
+	// the apply to proceed. See the type-level doc for how its meaning
+	// differs between a single checker's return value and the aggregate
+	// RunningOperation.PolicyResult.
+	Passed bool
+
+	// SoftFailures are violations that block an apply unless the
+	// operation sets PolicyOverride.
+	SoftFailures []Violation
+
+	// HardFailures are violations that always block an apply, regardless
+	// of PolicyOverride.
+	HardFailures []Violation
+}
+
+// Violation describes a single policy violation surfaced by a
+// PolicyChecker, suitable for display via UIOutput.
+type Violation struct {
+	// Checker identifies the PolicyChecker that produced this violation.
+	Checker string
+
+	// Message is a human-readable description of the violation.
+	Message string
+}
+
+// EventType identifies the kind of a streamed Event.
+type EventType string
+
+const (
+	EventPlanStarted         EventType = "PlanStarted"
+	EventResourceRefreshed   EventType = "ResourceRefreshed"
+	EventResourceProvisioned EventType = "ResourceProvisioned"
+	EventDiagnostic          EventType = "Diagnostic"
+	EventPolicyEvaluated     EventType = "PolicyEvaluated"
+	EventStateWritten        EventType = "StateWritten"
+	EventOperationCompleted  EventType = "OperationCompleted"
+)
+
+// Event is a single structured, JSON-serializable progress notification
+// emitted by an Enhanced backend over the course of an Operation.
+//
+// Events let CLI wrappers, CI systems, and remote UIs track an operation's
+// progress without scraping UIOutput strings.
+type Event struct {
+	// Seq is a monotonically increasing sequence number, unique within a
+	// single RunningOperation, that lets subscribers detect gaps or
+	// reorder buffered events.
+	Seq int
+
+	// Type identifies the kind of event.
+	Type EventType
+
+	// Timestamp is when the event was generated.
+	Timestamp time.Time
+
+	// Resource is the address of the resource the event pertains to, if
+	// any.
+	Resource string
+
+	// Payload carries event-specific, JSON-serializable data.
+	Payload interface{}
+}
+
 // Local implements additional behavior on a Backend that allows local
 // operations in addition to remote operations.
 //
@@ -86,6 +211,13 @@ type Operation struct {
 	// Module settings specify the root module to use for operations.
 	Module *module.Tree
 
+	// Workspace is the name of the workspace to run this operation
+	// against. Enhanced backends that implement MultiState must honor
+	// this, running the operation against that workspace's state rather
+	// than whatever workspace is currently selected. An empty Workspace
+	// means DefaultStateName.
+	Workspace string
+
 	// Plan is a plan that was passed as an argument. This is valid for
 	// plan and apply arguments but may not work for all backends.
 	Plan *terraform.Plan
@@ -96,12 +228,48 @@ type Operation struct {
 	Targets   []string
 	Variables map[string]interface{}
 
+	// PolicyCheckers are run against the plan after it is produced but
+	// before apply proceeds. Enhanced backends must invoke each checker
+	// and surface any violations through UIOut.
+	PolicyCheckers []PolicyChecker
+
+	// PolicyOverride allows an apply to proceed despite soft policy
+	// failures reported by PolicyCheckers. It has no effect on hard
+	// failures, which always block the operation.
+	PolicyOverride bool
+
+	// EventFilter, if non-empty, restricts the events a RunningOperation
+	// created for this Operation will deliver through Subscribe to those
+	// whose Type is in the set. An empty EventFilter means all events are
+	// delivered. Backends must pass this through via NewRunningOperation
+	// for it to take effect.
+	EventFilter []EventType
+
 	// Input/output/control options.
 	UIIn  terraform.UIInput
 	UIOut terraform.UIOutput
 }
 
 // RunningOperation is the result of starting an operation.
+//
+// Cancelation state machine: there are two distinct ways an in-flight
+// operation can be asked to stop, mirroring terraform.Context.Stop and
+// terraform.Context.Cancel.
+//
+//   - Canceling the context.Context passed to Enhanced.Operation, or
+//     calling Cancel, is a "hard" cancel: the backend must abort as soon
+//     as possible, set Err to context.Canceled, and still make a
+//     best-effort attempt to flush whatever state it has before this
+//     RunningOperation's Context becomes Done.
+//   - Calling Stop is a "soft" stop: the backend must let the current
+//     graph walk finish any in-flight resource operations and persist the
+//     resulting partial state, only then marking this RunningOperation's
+//     Context as Done.
+//
+// The Stopped channel is closed as soon as Stop or Cancel is called,
+// before the operation itself has finished; canceling the parent context
+// alone does not close Stopped or make Cancelled report true. Done/Context
+// is only closed once the operation has actually wound down.
 type RunningOperation struct {
 	// Context should be used to track Done and Err for errors.
 	//
@@ -120,8 +288,160 @@ type RunningOperation struct {
 	// to note whether a plan is empty or has changes.
 	PlanEmpty bool
 
+	// PolicyResult is populated after policy checks run, if the Operation
+	// had any PolicyCheckers configured. It is the aggregate across all
+	// of them, not any single checker's return value; see the PolicyResult
+	// type doc for how Passed is computed here versus in Check's return
+	// value. This should only be read after the operation completes to
+	// avoid read/write races.
+	PolicyResult *PolicyResult
+
 	// State is the final state after the operation completed. Persisting
 	// this state is managed by the backend. This should only be read
 	// after the operation completes to avoid read/write races.
 	State *terraform.State
+
+	mu          sync.Mutex
+	seq         int
+	subs        []func(Event)
+	eventFilter []EventType
+	hard        bool
+	stopped     chan struct{}
+}
+
+// NewRunningOperation returns a RunningOperation with ctx as its Context
+// and wired up to honor op's EventFilter when events are later delivered
+// through Subscribe. Backend implementations of Enhanced.Operation should
+// build their RunningOperation this way rather than with a bare struct
+// literal so that EventFilter actually takes effect.
+func NewRunningOperation(ctx context.Context, op *Operation) *RunningOperation {
+	return &RunningOperation{
+		Context:     ctx,
+		eventFilter: op.EventFilter,
+	}
+}
+
+// Stop requests a graceful, "soft" stop of the operation: the backend
+// should let the current graph walk complete any in-flight resource
+// operations and persist the resulting partial state before finishing.
+// It corresponds to terraform.Context.Stop.
+//
+// Stop is safe to call multiple times and from multiple goroutines; only
+// the first call has an effect.
+func (r *RunningOperation) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stop()
+}
+
+// Cancel requests an immediate, "hard" cancelation of the operation: the
+// backend should abort as soon as possible, set Err to context.Canceled,
+// and still make a best-effort attempt to flush whatever state it has. It
+// corresponds to terraform.Context.Cancel, and asks the backend for the
+// same hard cancel as canceling the context.Context originally passed to
+// Enhanced.Operation; unlike that, it also closes Stopped and makes
+// Cancelled report true.
+//
+// Cancel is safe to call multiple times and from multiple goroutines. The
+// stop signal itself (the closing of the Stopped channel) only happens
+// once, on whichever of Stop or Cancel is called first. However, the
+// hard/soft distinction reported by Cancelled is not latched the same
+// way: a Cancel that arrives after an earlier Stop still flips Cancelled
+// to true, upgrading the already-requested stop from soft to hard.
+func (r *RunningOperation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hard = true
+	r.stop()
+}
+
+// stop closes the stopped channel if it hasn't been closed already.
+// Callers must hold r.mu.
+func (r *RunningOperation) stop() {
+	if r.stopped == nil {
+		r.stopped = make(chan struct{})
+	}
+	select {
+	case <-r.stopped:
+	default:
+		close(r.stopped)
+	}
+}
+
+// Stopped returns a channel that is closed as soon as Stop or Cancel is
+// called, so that backends and observers can select on it instead of
+// polling. Use Cancelled to tell whether the stop that closed it was a
+// soft Stop or a hard Cancel.
+func (r *RunningOperation) Stopped() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped == nil {
+		r.stopped = make(chan struct{})
+	}
+	return r.stopped
+}
+
+// Cancelled reports whether the operation was asked to do a hard Cancel,
+// as opposed to a soft Stop. It is only meaningful after Stopped is
+// closed.
+func (r *RunningOperation) Cancelled() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.hard
+}
+
+// Subscribe registers f to be called with every Event emitted for the
+// remainder of this operation whose Type passes the originating
+// Operation's EventFilter (see NewRunningOperation). f may be called from
+// whatever goroutine the backend uses to drive the operation, so it must
+// not block.
+func (r *RunningOperation) Subscribe(f func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs = append(r.subs, f)
+}
+
+// Emit delivers event to every subscriber registered via Subscribe,
+// assigning it the next sequence number and, if unset, the current time.
+// Events whose Type doesn't pass the originating Operation's EventFilter
+// are dropped before being assigned a sequence number or delivered.
+// Enhanced backends call this as they make progress through an operation;
+// callers of Operation should not call it themselves.
+//
+// Subscriber callbacks are invoked without r.mu held, so it is safe for a
+// subscriber to call back into Stop, Cancel, Stopped, Cancelled, or
+// Subscribe on the same RunningOperation — for example stopping the
+// operation from an EventPolicyEvaluated handler that saw a hard failure.
+func (r *RunningOperation) Emit(event Event) {
+	r.mu.Lock()
+	if !r.passesFilter(event.Type) {
+		r.mu.Unlock()
+		return
+	}
+	r.seq++
+	event.Seq = r.seq
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	subs := make([]func(Event), len(r.subs))
+	copy(subs, r.subs)
+	r.mu.Unlock()
+
+	for _, f := range subs {
+		f(event)
+	}
+}
+
+// passesFilter reports whether t should be delivered given eventFilter.
+// Callers must hold r.mu.
+func (r *RunningOperation) passesFilter(t EventType) bool {
+	if len(r.eventFilter) == 0 {
+		return true
+	}
+	for _, want := range r.eventFilter {
+		if want == t {
+			return true
+		}
+	}
+	return false
 }
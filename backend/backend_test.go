@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRunningOperation_EmitSubscribe(t *testing.T) {
+	run := NewRunningOperation(context.Background(), &Operation{})
+
+	var got []Event
+	run.Subscribe(func(e Event) {
+		got = append(got, e)
+	})
+
+	run.Emit(Event{Type: EventPlanStarted})
+	run.Emit(Event{Type: EventStateWritten})
+	run.Emit(Event{Type: EventOperationCompleted})
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(got))
+	}
+	for i, e := range got {
+		if e.Seq != i+1 {
+			t.Fatalf("event %d: expected Seq %d, got %d", i, i+1, e.Seq)
+		}
+	}
+	if got[0].Timestamp.IsZero() {
+		t.Fatalf("expected Emit to fill in a zero Timestamp")
+	}
+}
+
+func TestRunningOperation_SubscriberCanStopFromCallback(t *testing.T) {
+	run := NewRunningOperation(context.Background(), &Operation{})
+
+	run.Subscribe(func(e Event) {
+		if e.Type == EventPolicyEvaluated {
+			// Must not deadlock: Emit must not hold r.mu while invoking
+			// subscribers.
+			run.Stop()
+		}
+	})
+
+	run.Emit(Event{Type: EventPolicyEvaluated})
+
+	select {
+	case <-run.Stopped():
+	default:
+		t.Fatalf("expected Stopped to be closed after subscriber called Stop")
+	}
+}
+
+func TestRunningOperation_EmitEventFilter(t *testing.T) {
+	run := NewRunningOperation(context.Background(), &Operation{
+		EventFilter: []EventType{EventDiagnostic},
+	})
+
+	var got []Event
+	run.Subscribe(func(e Event) {
+		got = append(got, e)
+	})
+
+	run.Emit(Event{Type: EventPlanStarted})
+	run.Emit(Event{Type: EventDiagnostic})
+	run.Emit(Event{Type: EventStateWritten})
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 event to pass the filter, got %d", len(got))
+	}
+	if got[0].Type != EventDiagnostic {
+		t.Fatalf("expected the delivered event to be %q, got %q", EventDiagnostic, got[0].Type)
+	}
+	if got[0].Seq != 1 {
+		t.Fatalf("expected the filtered-in event to still get Seq 1, got %d", got[0].Seq)
+	}
+}
+
+func TestRunningOperation_StoppedBeforeAnyStopOrCancel(t *testing.T) {
+	run := NewRunningOperation(context.Background(), &Operation{})
+
+	select {
+	case <-run.Stopped():
+		t.Fatalf("expected Stopped to be open before Stop/Cancel is called")
+	default:
+	}
+	if run.Cancelled() {
+		t.Fatalf("expected Cancelled to be false before Stop/Cancel is called")
+	}
+}
+
+func TestRunningOperation_StopIsSoftAndIdempotent(t *testing.T) {
+	run := NewRunningOperation(context.Background(), &Operation{})
+
+	run.Stop()
+	run.Stop()
+
+	select {
+	case <-run.Stopped():
+	default:
+		t.Fatalf("expected Stopped to be closed after Stop")
+	}
+	if run.Cancelled() {
+		t.Fatalf("expected Cancelled to be false after only Stop was called")
+	}
+}
+
+func TestRunningOperation_CancelIsHard(t *testing.T) {
+	run := NewRunningOperation(context.Background(), &Operation{})
+
+	run.Cancel()
+	run.Cancel()
+
+	select {
+	case <-run.Stopped():
+	default:
+		t.Fatalf("expected Stopped to be closed after Cancel")
+	}
+	if !run.Cancelled() {
+		t.Fatalf("expected Cancelled to be true after Cancel")
+	}
+}
+
+func TestRunningOperation_CancelUpgradesPriorStop(t *testing.T) {
+	run := NewRunningOperation(context.Background(), &Operation{})
+
+	run.Stop()
+	if run.Cancelled() {
+		t.Fatalf("expected Cancelled to be false right after Stop")
+	}
+
+	run.Cancel()
+	if !run.Cancelled() {
+		t.Fatalf("expected a later Cancel to upgrade a pending Stop to Cancelled")
+	}
+
+	select {
+	case <-run.Stopped():
+	default:
+		t.Fatalf("expected Stopped to still be closed after the upgrade")
+	}
+}